@@ -2,19 +2,18 @@ package main
 
 import (
 	"bufio"
-	"bytes"
 	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
-	"regexp"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -23,48 +22,17 @@ import (
 	"github.com/go-telegram/bot/models"
 )
 
-var tiktokRegex = regexp.MustCompile(`https?://(?:vm|vt|www)\.tiktok\.com/[a-zA-Z0-9/]+`)
-
 const (
 	cacheTTL       = 10 * time.Minute
 	startTokenPref = "tt_"
 	logPrefix      = "[tiktok-bot]"
 )
 
-type cacheItem struct {
-	url     string
-	expires time.Time
-}
-
-type linkCache struct {
-	mu    sync.Mutex
-	items map[string]cacheItem
-}
-
-func newLinkCache() *linkCache {
-	return &linkCache{items: make(map[string]cacheItem)}
-}
-
-func (c *linkCache) set(url string) string {
-	token := randomToken(12)
-	c.mu.Lock()
-	c.items[token] = cacheItem{url: url, expires: time.Now().Add(cacheTTL)}
-	c.mu.Unlock()
-	return token
-}
-
-func (c *linkCache) get(token string) (string, bool) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	item, ok := c.items[token]
-	if !ok {
-		return "", false
-	}
-	if time.Now().After(item.expires) {
-		delete(c.items, token)
-		return "", false
+func dbPath() string {
+	if v := os.Getenv("DB_PATH"); v != "" {
+		return v
 	}
-	return item.url, true
+	return "bot.db"
 }
 
 func randomToken(size int) string {
@@ -76,18 +44,45 @@ func randomToken(size int) string {
 }
 
 func main() {
+	dbInfoPath := flag.String("dbinfo", "", "open the given sqlite db read-only, print stats, and exit")
+	flag.Parse()
+
+	if *dbInfoPath != "" {
+		if err := runDBInfo(*dbInfoPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	loadEnvFile(".env")
+
+	adminUsers = parseIDSet(os.Getenv("ADMIN_USERS"))
+	allowedUsers = newUserSet(parseIDSet(os.Getenv("BOT_ALLOWED_USERS")))
+
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
+	var err error
+	store, err = openStore(dbPath())
+	if err != nil {
+		panic(err)
+	}
+	defer store.Close()
+
+	if granted, err := store.LoadAllowed(); err != nil {
+		logTikTok("main load_allowed status=error err=%v", err)
+	} else {
+		for id := range granted {
+			allowedUsers.add(id)
+		}
+	}
+
 	opts := []bot.Option{
 		bot.WithDefaultHandler(mainRouter),
 	}
 
 	token := os.Getenv("TOKEN")
-	if token == "" {
-		loadEnvFile(".env")
-		token = os.Getenv("TOKEN")
-	}
 	if token == "" {
 		panic("empty TOKEN env")
 	}
@@ -101,7 +96,7 @@ func main() {
 	b.Start(ctx)
 }
 
-var inlineCache = newLinkCache()
+var store *Store
 
 func logTikTok(format string, args ...interface{}) {
 	log.Printf("%s %s", logPrefix, fmt.Sprintf(format, args...))
@@ -110,76 +105,95 @@ func logTikTok(format string, args ...interface{}) {
 func mainRouter(ctx context.Context, b *bot.Bot, update *models.Update) {
 	if update.InlineQuery != nil {
 		log.Printf("incoming update type=inline_query id=%s query=%q", update.InlineQuery.ID, update.InlineQuery.Query)
+		var userID int64
+		if update.InlineQuery.From != nil {
+			userID = update.InlineQuery.From.ID
+		}
+		if !isAllowed(userID) {
+			logTikTok("mainRouter denied user_id=%d update=inline_query", userID)
+			b.AnswerInlineQuery(ctx, &bot.AnswerInlineQueryParams{
+				InlineQueryID: update.InlineQuery.ID,
+				Results:       []models.InlineQueryResult{},
+			})
+			return
+		}
 		handlerInline(ctx, b, update)
 		return
 	}
 	if update.Message != nil {
 		log.Printf("incoming update type=message chat_id=%d text=%q", update.Message.Chat.ID, update.Message.Text)
+		var userID int64
+		if update.Message.From != nil {
+			userID = update.Message.From.ID
+		}
+		if !isAllowed(userID) {
+			logTikTok("mainRouter denied user_id=%d update=message", userID)
+			b.SendMessage(ctx, &bot.SendMessageParams{
+				ChatID: update.Message.Chat.ID,
+				Text:   "Этот бот доступен только по приглашению.",
+			})
+			return
+		}
 		handlerMessage(ctx, b, update)
 	}
 }
 
+// allowedUsers is seeded from BOT_ALLOWED_USERS in main, after loadEnvFile
+// has had a chance to populate the environment, and merged with whatever
+// /grant has persisted to the store since. It must not read the env at
+// package-var-init time: that runs before main's loadEnvFile(".env") call,
+// so a .env-only BOT_ALLOWED_USERS would otherwise always read as empty.
+var allowedUsers = newUserSet(nil)
+
+func isAllowed(userID int64) bool {
+	return adminUsers[userID] || allowedUsers.has(userID)
+}
+
 func handlerInline(ctx context.Context, b *bot.Bot, update *models.Update) {
 	inlineID := update.InlineQuery.ID
 	query := update.InlineQuery.Query
 	log.Printf("inline query received id=%s query=%q", inlineID, query)
 
-	link := tiktokRegex.FindString(query)
+	link := linkRegex.FindString(query)
 	log.Printf("inline query parsed link id=%s link=%q", inlineID, link)
 	if link == "" {
 		return
 	}
 	logTikTok("handlerInline link=%s", link)
 
-	rs, err := fetchTikTok(link)
-	hasImages := rs != nil && len(rs.Data.Images) > 0
-	hasPlay := rs != nil && rs.Data.Play != ""
-	imageCount := 0
-	if rs != nil {
-		imageCount = len(rs.Data.Images)
+	var userID int64
+	if update.InlineQuery.From != nil {
+		userID = update.InlineQuery.From.ID
 	}
-	if err != nil || (rs.Data.Play == "" && len(rs.Data.Images) == 0) {
-		status := "success"
-		if err != nil {
-			status = "error"
-		}
-		if rs == nil {
-			logTikTok("handlerInline fetch status=%s link=%s err=%v", status, link, err)
-		} else {
-			logTikTok(
-				"handlerInline fetch status=%s link=%s has_images=%t has_play=%t image_count=%d err=%v",
-				status,
-				link,
-				len(rs.Data.Images) > 0,
-				rs.Data.Play != "",
-				len(rs.Data.Images),
-				err,
-			)
-		}
+	if !fetchLimiter.Allow(userID) {
+		logTikTok("handlerInline rate_limited user_id=%d link=%s", userID, link)
+		return
+	}
+
+	up, err := resolveLink(ctx, link)
+	if err != nil {
+		logTikTok("handlerInline resolve status=error link=%s err=%v", link, err)
 		return
 	}
-	logTikTok(
-		"handlerInline fetch status=success link=%s has_images=%t has_play=%t image_count=%d",
-		link,
-		len(rs.Data.Images) > 0,
-		rs.Data.Play != "",
-		len(rs.Data.Images),
-	)
 
-	if hasImages {
+	if up.Images != nil {
 		botUsername := os.Getenv("BOT_USERNAME")
 		if botUsername == "" {
 			log.Printf("inline query bot username empty id=%s link=%q", inlineID, link)
 			return
 		}
 
-		token := inlineCache.set(link)
+		token, err := store.Set(link, userID, 0, cacheTTL)
+		if err != nil {
+			logTikTok("handlerInline store status=error link=%s err=%v", link, err)
+			return
+		}
 		deepLink := fmt.Sprintf("https://t.me/%s?start=%s%s", botUsername, startTokenPref, token)
 
 		results := []models.InlineQueryResult{
 			&models.InlineQueryResultArticle{
 				ID:          "1",
-				Title:       "Слайдшоу TikTok",
+				Title:       "Слайдшоу",
 				Description: "Откройте чат с ботом, чтобы получить все фото",
 				InputMessageContent: &models.InputTextMessageContent{
 					MessageText: fmt.Sprintf("Нажмите кнопку ниже, чтобы скачать слайдшоу. [src](%s)", link),
@@ -206,11 +220,11 @@ func handlerInline(ctx context.Context, b *bot.Bot, update *models.Update) {
 	results := []models.InlineQueryResult{
 		&models.InlineQueryResultVideo{
 			ID:           "1",
-			VideoURL:     rs.Data.Play,
+			VideoURL:     up.VideoURL,
 			MimeType:     "video/mp4",
-			ThumbnailURL: rs.Data.Cover,
-			Title:        rs.Data.Title,
-			Caption:      fmt.Sprintf("[src](%s)", link),
+			ThumbnailURL: up.ThumbnailURL,
+			Title:        up.Title,
+			Caption:      up.Caption,
 			ParseMode:    models.ParseModeMarkdown,
 		},
 	}
@@ -227,28 +241,162 @@ func handlerMessage(ctx context.Context, b *bot.Bot, update *models.Update) {
 		return
 	}
 
+	if update.Message.Text == "/stats" {
+		handleStatsCommand(ctx, b, update)
+		return
+	}
+
+	if strings.HasPrefix(update.Message.Text, "/grant ") || strings.HasPrefix(update.Message.Text, "/revoke ") {
+		handleGrantRevoke(ctx, b, update)
+		return
+	}
+
 	if handleStartPayload(ctx, b, update) {
 		return
 	}
 
-	link := tiktokRegex.FindString(update.Message.Text)
+	link := linkRegex.FindString(update.Message.Text)
 	if link == "" {
 		return
 	}
 	logTikTok("handlerMessage link=%s", link)
 
-	rs, err := sendTikTok(ctx, b, update.Message.Chat.ID, link)
+	var userID int64
+	if update.Message.From != nil {
+		userID = update.Message.From.ID
+	}
+	if !fetchLimiter.Allow(userID) {
+		logTikTok("handlerMessage rate_limited user_id=%d link=%s", userID, link)
+		b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text:   "Слишком много запросов, подождите немного.",
+		})
+		return
+	}
+
+	token, err := store.Set(link, userID, update.Message.Chat.ID, cacheTTL)
+	if err != nil {
+		logTikTok("handlerMessage store status=error link=%s err=%v", link, err)
+		token = ""
+	}
+
+	if err := sendLink(ctx, b, update.Message.Chat.ID, link, token); err != nil {
+		logTikTok("handlerMessage resolve status=error link=%s err=%v", link, err)
+	}
+}
+
+// handleGrantRevoke implements the admin-only /grant <id> and /revoke <id>
+// commands, mutating both the persisted allowlist and the in-memory set
+// mainRouter checks on every update.
+func handleGrantRevoke(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	if update.Message.From == nil || !adminUsers[update.Message.From.ID] {
+		return
+	}
+
+	parts := strings.Fields(update.Message.Text)
+	if len(parts) != 2 {
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: "Использование: /grant <id> или /revoke <id>"})
+		return
+	}
+
+	id, err := strconv.ParseInt(parts[1], 10, 64)
 	if err != nil {
-		logTikTok("handlerMessage fetch status=error link=%s err=%v", link, err)
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: "Некорректный id пользователя"})
 		return
 	}
-	logTikTok(
-		"handlerMessage fetch status=success link=%s has_images=%t has_play=%t image_count=%d",
-		link,
-		len(rs.Data.Images) > 0,
-		rs.Data.Play != "",
-		len(rs.Data.Images),
-	)
+
+	switch parts[0] {
+	case "/grant":
+		err = store.Grant(id)
+		if err == nil {
+			allowedUsers.add(id)
+		}
+	case "/revoke":
+		err = store.Revoke(id)
+		if err == nil {
+			allowedUsers.remove(id)
+		}
+	}
+	if err != nil {
+		logTikTok("handleGrantRevoke status=error cmd=%s id=%d err=%v", parts[0], id, err)
+		b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: "Ошибка при обновлении списка доступа"})
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{ChatID: chatID, Text: fmt.Sprintf("OK: %s %d", parts[0], id)})
+}
+
+// adminUsers is seeded from ADMIN_USERS in main, after loadEnvFile has run,
+// for the same reason as allowedUsers above.
+var adminUsers map[int64]bool
+
+func parseIDSet(raw string) map[int64]bool {
+	set := make(map[int64]bool)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			continue
+		}
+		set[id] = true
+	}
+	return set
+}
+
+// userSet is a mutex-guarded set of user IDs, used for allowedUsers since
+// /grant and /revoke mutate it at runtime (unlike the static adminUsers).
+type userSet struct {
+	mu  sync.RWMutex
+	ids map[int64]bool
+}
+
+func newUserSet(initial map[int64]bool) *userSet {
+	if initial == nil {
+		initial = make(map[int64]bool)
+	}
+	return &userSet{ids: initial}
+}
+
+func (s *userSet) has(id int64) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.ids[id]
+}
+
+func (s *userSet) add(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ids[id] = true
+}
+
+func (s *userSet) remove(id int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ids, id)
+}
+
+// handleStatsCommand answers the admin-only /stats command with the same
+// aggregate view -dbinfo prints from the command line.
+func handleStatsCommand(ctx context.Context, b *bot.Bot, update *models.Update) {
+	chatID := update.Message.Chat.ID
+	if update.Message.From == nil || !adminUsers[update.Message.From.ID] {
+		return
+	}
+
+	stats, err := store.Stats(10)
+	if err != nil {
+		logTikTok("handleStatsCommand status=error err=%v", err)
+		return
+	}
+
+	b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   formatStats(stats),
+	})
 }
 
 func handleStartPayload(ctx context.Context, b *bot.Bot, update *models.Update) bool {
@@ -266,7 +414,7 @@ func handleStartPayload(ctx context.Context, b *bot.Bot, update *models.Update)
 	}
 
 	token := strings.TrimPrefix(payload, startTokenPref)
-	link, ok := inlineCache.get(token)
+	link, ok := store.Get(token)
 	if !ok {
 		b.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: update.Message.Chat.ID,
@@ -275,43 +423,129 @@ func handleStartPayload(ctx context.Context, b *bot.Bot, update *models.Update)
 		return true
 	}
 
-	sendTikTok(ctx, b, update.Message.Chat.ID, link)
+	sendLink(ctx, b, update.Message.Chat.ID, link, token)
 	return true
 }
 
-func sendTikTok(ctx context.Context, b *bot.Bot, chatID int64, link string) (*response, error) {
-	rs, err := fetchTikTok(link)
+// sendLink resolves link through the registered provider chain and delivers
+// whatever it resolves to: a slideshow render, a direct video, or (once a
+// provider returns one) a local file upload. token, if non-empty, is the
+// link-cache token this delivery satisfies, recorded against it for /stats
+// and -dbinfo.
+func sendLink(ctx context.Context, b *bot.Bot, chatID int64, link, token string) error {
+	up, err := resolveLink(ctx, link)
 	if err != nil {
-		logTikTok("sendTikTok status=error link=%s err=%v", link, err)
-		return nil, err
-	}
-	logTikTok(
-		"sendTikTok status=success link=%s has_images=%t has_play=%t image_count=%d",
-		link,
-		len(rs.Data.Images) > 0,
-		rs.Data.Play != "",
-		len(rs.Data.Images),
-	)
-
-	if hasImages {
-		caption := fmt.Sprintf("[src](%s)", link)
-		sendPhotoGroups(ctx, b, chatID, rs.Data.Images, caption)
-		return rs, nil
+		logTikTok("sendLink resolve status=error link=%s err=%v", link, err)
+		return err
 	}
+	logTikTok("sendLink resolve status=success link=%s has_images=%t has_video=%t", link, up.Images != nil, up.VideoURL != "")
 
-	if rs.Data.Play != "" {
-		sizeText := "unknown"
-		if size, err := fetchContentLength(rs.Data.Play); err == nil {
-			sizeText = fmt.Sprintf("%d bytes", size)
-		}
-		fmt.Printf("TikTok video found, sending: url=%s size=%s\n", rs.Data.Play, sizeText)
+	switch {
+	case up.Images != nil:
+		sendSlideshow(ctx, b, chatID, up, link, token)
+	case up.VideoURL != "":
+		size, _ := fetchContentLength(up.VideoURL)
+		fmt.Printf("video found, sending: url=%s size=%d bytes\n", up.VideoURL, size)
 
 		b.SendVideo(ctx, &bot.SendVideoParams{
 			ChatID: chatID,
-			Video:  &models.InputFileString{Data: rs.Data.Play},
+			Video:  &models.InputFileString{Data: up.VideoURL},
+		})
+		recordDelivery(token, "video", size)
+	case up.FilePath != "":
+		file, err := os.Open(up.FilePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		info, _ := file.Stat()
+		b.SendVideo(ctx, &bot.SendVideoParams{
+			ChatID:    chatID,
+			Video:     &models.InputFileUpload{Filename: "video.mp4", Data: file},
+			Caption:   up.Caption,
+			ParseMode: models.ParseModeMarkdown,
 		})
+		var size int64
+		if info != nil {
+			size = info.Size()
+		}
+		recordDelivery(token, "file", size)
 	}
-	return rs, nil
+	return nil
+}
+
+// recordDelivery is a no-op when token is empty, which only happens if
+// store.Set itself failed for the delivery in question.
+func recordDelivery(token, kind string, bytesSent int64) {
+	if token == "" {
+		return
+	}
+	if err := store.RecordDelivery(token, kind, bytesSent); err != nil {
+		logTikTok("recordDelivery status=error token=%s err=%v", token, err)
+	}
+}
+
+// sendSlideshow renders an image slideshow plus its audio track into an MP4
+// via makeVideo and uploads it with b.SendVideo. If ffmpeg isn't available or
+// rendering fails, it falls back to sendPhotoGroups so the user still gets
+// the images.
+func sendSlideshow(ctx context.Context, b *bot.Bot, chatID int64, up *Uploadable, link, token string) {
+	images := up.Images
+
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		logTikTok("sendSlideshow ffmpeg_missing link=%s", link)
+		sendPhotoGroups(ctx, b, chatID, images.ImageURLs, up.Caption)
+		recordDelivery(token, "photo_group", 0)
+		return
+	}
+
+	status, _ := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: chatID,
+		Text:   "Генерация видео…",
+	})
+
+	video, err := makeVideo(ctx, images.ImageURLs, images.AudioURL, images.Duration)
+	if status != nil {
+		b.DeleteMessage(ctx, &bot.DeleteMessageParams{ChatID: chatID, MessageID: status.ID})
+	}
+	if err != nil {
+		logTikTok("sendSlideshow makeVideo status=error link=%s err=%v", link, err)
+		sendPhotoGroups(ctx, b, chatID, images.ImageURLs, up.Caption)
+		recordDelivery(token, "photo_group", 0)
+		return
+	}
+
+	counted := &countingReader{Reader: video}
+	_, sendErr := b.SendVideo(ctx, &bot.SendVideoParams{
+		ChatID: chatID,
+		Video: &models.InputFileUpload{
+			Filename: "slideshow.mp4",
+			Data:     counted,
+		},
+		Caption:   up.Caption,
+		ParseMode: models.ParseModeMarkdown,
+	})
+	closeErr := video.Close()
+	if closeErr != nil {
+		logTikTok("sendSlideshow makeVideo close status=error link=%s err=%v", link, closeErr)
+	}
+
+	if sendErr != nil {
+		logTikTok("sendSlideshow sendvideo status=error link=%s err=%v", link, sendErr)
+		sendPhotoGroups(ctx, b, chatID, images.ImageURLs, up.Caption)
+		recordDelivery(token, "photo_group", 0)
+		return
+	}
+	if closeErr != nil {
+		// SendVideo already read every byte ffmpeg produced and Telegram
+		// accepted the upload, so the video was delivered -- just not
+		// cleanly rendered. Record it as such rather than re-sending.
+		recordDelivery(token, "video_error", counted.n)
+		return
+	}
+
+	logTikTok("sendSlideshow makeVideo status=success link=%s bytes=%d", link, counted.n)
+	recordDelivery(token, "video", counted.n)
 }
 
 func sendPhotoGroups(ctx context.Context, b *bot.Bot, chatID int64, imageURLs []string, caption string) {
@@ -341,18 +575,48 @@ func sendPhotoGroups(ctx context.Context, b *bot.Bot, chatID int64, imageURLs []
 	}
 }
 
-func fetchTikTok(url string) (*response, error) {
-	resp, err := http.Get(fmt.Sprintf("https://www.tikwm.com/api/?url=%s", url))
-	if err != nil {
-		logTikTok("fetchTikTok status=error link=%s err=%v", url, err)
-		return nil, err
+// nonRetryableTikTokMsgs are tikwm "msg" fields that mean the link itself is
+// bad (malformed, deleted, private, region-locked) rather than a transient
+// upstream hiccup, so retrying would just waste attempts.
+var nonRetryableTikTokMsgs = []string{
+	"Url parsing is failed",
+	"Video not found",
+	"This video is private",
+	"This creator has set their account to private",
+}
+
+func classifyTikTokErr(rs *response, err error) retryClass {
+	if err == nil {
+		return retryable
 	}
-	defer resp.Body.Close()
-	logTikTok("fetchTikTok http_status=%d link=%s", resp.StatusCode, url)
+	if rs != nil {
+		for _, msg := range nonRetryableTikTokMsgs {
+			if strings.Contains(rs.Msg, msg) {
+				return terminal
+			}
+		}
+	}
+	return retryable
+}
 
-	var rs response
-	if err := json.NewDecoder(resp.Body).Decode(&rs); err != nil {
-		logTikTok("fetchTikTok json_decode_error link=%s err=%v", url, err)
+// fetchTikTok retries fetchTikTokOnce with exponential backoff, honoring ctx
+// cancellation and bailing out immediately on a non-retryable tikwm error.
+func fetchTikTok(ctx context.Context, url string) (*response, error) {
+	var rs *response
+	err := withRetry(ctx, func(attempt int) (retryClass, error) {
+		r, httpStatus, err := fetchTikTokOnce(ctx, url)
+		class := classifyTikTokErr(r, err)
+		logTikTok(
+			"fetchTikTok attempt=%d/%d link=%s http_status=%d retryable=%t err=%v",
+			attempt, retryMaxAttempts, url, httpStatus, class == retryable, err,
+		)
+		if err != nil {
+			return class, err
+		}
+		rs = r
+		return retryable, nil
+	})
+	if err != nil {
 		return nil, err
 	}
 	logTikTok(
@@ -362,104 +626,44 @@ func fetchTikTok(url string) (*response, error) {
 		rs.Data.Play != "",
 		len(rs.Data.Images),
 	)
-	return &rs, nil
+	return rs, nil
 }
 
-func fetchContentLength(url string) (int64, error) {
-	resp, err := http.Head(url)
+// fetchTikTokOnce makes a single attempt against tikwm and returns the
+// decoded envelope, the HTTP status observed, and an error representing
+// either a transport/decode failure or a non-zero tikwm "code".
+func fetchTikTokOnce(ctx context.Context, url string) (*response, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://www.tikwm.com/api/?url=%s", url), nil)
 	if err != nil {
-		return 0, err
-	}
-	defer resp.Body.Close()
-	if resp.ContentLength <= 0 {
-		return 0, fmt.Errorf("unknown content length")
+		return nil, 0, err
 	}
-	return resp.ContentLength, nil
-}
-
-func makeVideo(imageURLs []string, audioURL string, duration int) ([]byte, error) {
-	if duration <= 0 {
-		duration = 10
-	}
-
-	var wg sync.WaitGroup
-	imgBufs := make([][]byte, len(imageURLs))
-	var audBuf []byte
-
-	wg.Add(len(imageURLs) + 1)
 
-	go func() {
-		defer wg.Done()
-		audBuf, _ = downloadToMem(audioURL)
-	}()
-
-	for i, url := range imageURLs {
-		go func(idx int, u string) {
-			defer wg.Done()
-			imgBufs[idx], _ = downloadToMem(u)
-		}(i, url)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, 0, err
 	}
-	wg.Wait()
+	defer resp.Body.Close()
 
-	if audBuf == nil {
-		return nil, fmt.Errorf("failed to download audio")
+	var rs response
+	if err := json.NewDecoder(resp.Body).Decode(&rs); err != nil {
+		return nil, resp.StatusCode, err
 	}
-
-	imgReader, imgWriter, _ := os.Pipe()
-	audReader, audWriter, _ := os.Pipe()
-
-	frameRate := float64(len(imageURLs)) / float64(duration)
-	vf := "scale=480:854:force_original_aspect_ratio=decrease,pad=480:854:(ow-iw)/2:(oh-ih)/2,setsar=1"
-
-	cmd := exec.Command("ffmpeg", "-y",
-		"-framerate", fmt.Sprintf("%f", frameRate),
-		"-f", "image2pipe", "-i", "pipe:3",
-		"-i", "pipe:4",
-		"-c:v", "libx264", "-preset", "ultrafast", "-tune", "stillimage",
-		"-c:a", "aac", "-b:a", "96k",
-		"-pix_fmt", "yuv420p", "-vf", vf,
-		"-shortest", "-fflags", "+genpts",
-		"-movflags", "frag_keyframe+empty_moov+default_base_moof",
-		"-f", "mp4", "pipe:1",
-	)
-
-	cmd.ExtraFiles = []*os.File{imgReader, audReader}
-	var outBuf, errBuf bytes.Buffer
-	cmd.Stdout = &outBuf
-	cmd.Stderr = &errBuf
-
-	if err := cmd.Start(); err != nil {
-		return nil, err
+	if rs.Code != 0 {
+		return &rs, resp.StatusCode, fmt.Errorf("tikwm: %s", rs.Msg)
 	}
-
-	go func() {
-		defer imgWriter.Close()
-		for _, b := range imgBufs {
-			if b != nil {
-				imgWriter.Write(b)
-			}
-		}
-	}()
-
-	go func() {
-		defer audWriter.Close()
-		audWriter.Write(audBuf)
-	}()
-
-	if err := cmd.Wait(); err != nil {
-		return nil, fmt.Errorf("ffmpeg: %v, stderr: %s", err, errBuf.String())
-	}
-
-	return outBuf.Bytes(), nil
+	return &rs, resp.StatusCode, nil
 }
 
-func downloadToMem(url string) ([]byte, error) {
-	resp, err := http.Get(url)
+func fetchContentLength(url string) (int64, error) {
+	resp, err := http.Head(url)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	defer resp.Body.Close()
-	return io.ReadAll(resp.Body)
+	if resp.ContentLength <= 0 {
+		return 0, fmt.Errorf("unknown content length")
+	}
+	return resp.ContentLength, nil
 }
 
 func loadEnvFile(path string) {
@@ -492,6 +696,8 @@ func loadEnvFile(path string) {
 }
 
 type response struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
 	Data struct {
 		Title     string   `json:"title"`
 		Cover     string   `json:"cover"`
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// linkRegex matches a short-video link for any host we have a Responder
+// registered for. It replaces the old TikTok-only tiktokRegex.
+var linkRegex = regexp.MustCompile(`https?://(?:[-\w]+\.)?(?:tiktok\.com|instagram\.com|youtube\.com|youtu\.be)(?:/\S*)?`)
+
+// ImagesWithAudio is the slideshow shape: a set of images meant to be muxed
+// against a single audio track, as TikTok and cobalt's "picker" mode return.
+type ImagesWithAudio struct {
+	ImageURLs []string
+	AudioURL  string
+	Duration  int
+}
+
+// Uploadable is what a Responder resolves a link to: exactly one of VideoURL,
+// Images or FilePath is set, describing how the caller should deliver it.
+type Uploadable struct {
+	VideoURL     string
+	Images       *ImagesWithAudio
+	FilePath     string
+	Caption      string
+	Title        string
+	ThumbnailURL string
+}
+
+func (u *Uploadable) empty() bool {
+	return u.VideoURL == "" && u.Images == nil && u.FilePath == ""
+}
+
+// Responder resolves a parsed short-video URL into an Uploadable.
+type Responder interface {
+	Respond(ctx context.Context, u *url.URL) (*Uploadable, error)
+}
+
+var providerRegistry = map[string][]Responder{}
+
+// registerProvider appends r to the list of Responders tried for host, in
+// registration order. mainRouter tries them in turn until one succeeds.
+func registerProvider(host string, r Responder) {
+	providerRegistry[host] = append(providerRegistry[host], r)
+}
+
+func init() {
+	for _, host := range []string{"tiktok.com", "vm.tiktok.com", "vt.tiktok.com"} {
+		registerProvider(host, tikwmProvider{})
+		registerProvider(host, cobaltProvider{})
+	}
+	registerProvider("instagram.com", instagramProvider{})
+	registerProvider("instagram.com", cobaltProvider{})
+	registerProvider("youtube.com", youtubeProvider{})
+	registerProvider("youtube.com", cobaltProvider{})
+	registerProvider("youtu.be", youtubeProvider{})
+	registerProvider("youtu.be", cobaltProvider{})
+}
+
+// resolveLink picks the registered provider chain for link's host and walks
+// it in order, retrying the next provider when one errors or comes back
+// empty. This is what gives the bot a resilient path when tikwm rate-limits.
+func resolveLink(ctx context.Context, link string) (*Uploadable, error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return nil, fmt.Errorf("resolveLink: parse link: %w", err)
+	}
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	responders := providerRegistry[host]
+	if len(responders) == 0 {
+		return nil, fmt.Errorf("resolveLink: no provider registered for host %q", host)
+	}
+
+	var lastErr error
+	for _, r := range responders {
+		up, err := r.Respond(ctx, u)
+		if err != nil {
+			logTikTok("resolveLink provider=%T host=%s status=error err=%v", r, host, err)
+			lastErr = err
+			continue
+		}
+		if up == nil || up.empty() {
+			logTikTok("resolveLink provider=%T host=%s status=empty", r, host)
+			lastErr = fmt.Errorf("%T: empty response", r)
+			continue
+		}
+		logTikTok("resolveLink provider=%T host=%s status=success", r, host)
+		return up, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("resolveLink: no provider could resolve %s", link)
+	}
+	return nil, lastErr
+}
+
+// tikwmProvider is the original tikwm.com-backed TikTok responder.
+type tikwmProvider struct{}
+
+func (tikwmProvider) Respond(ctx context.Context, u *url.URL) (*Uploadable, error) {
+	rs, err := fetchTikTok(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+	out := &Uploadable{
+		Caption:      fmt.Sprintf("[src](%s)", u.String()),
+		Title:        rs.Data.Title,
+		ThumbnailURL: rs.Data.Cover,
+	}
+	if len(rs.Data.Images) > 0 {
+		out.Images = &ImagesWithAudio{
+			ImageURLs: rs.Data.Images,
+			AudioURL:  rs.Data.Music,
+			Duration:  rs.Data.MusicInfo.Duration,
+		}
+		return out, nil
+	}
+	if rs.Data.Play == "" {
+		return nil, fmt.Errorf("tikwm: empty response for %s", u)
+	}
+	out.VideoURL = rs.Data.Play
+	return out, nil
+}
+
+// cobaltProvider talks to a cobalt (github.com/imputnet/cobalt) instance,
+// which can resolve TikTok, Instagram and YouTube links alike. It's
+// registered as a fallback behind the dedicated providers for each host.
+type cobaltProvider struct{}
+
+func cobaltAPIBase() string {
+	if v := os.Getenv("COBALT_API_URL"); v != "" {
+		return strings.TrimSuffix(v, "/")
+	}
+	return "https://api.cobalt.tools"
+}
+
+type cobaltRequest struct {
+	URL string `json:"url"`
+}
+
+type cobaltPickerItem struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cobaltResponse struct {
+	Status string             `json:"status"`
+	URL    string             `json:"url"`
+	Audio  string             `json:"audio"`
+	Picker []cobaltPickerItem `json:"picker"`
+}
+
+func (cobaltProvider) Respond(ctx context.Context, u *url.URL) (*Uploadable, error) {
+	body, err := json.Marshal(cobaltRequest{URL: u.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, cobaltAPIBase()+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var cr cobaltResponse
+	if err := json.NewDecoder(resp.Body).Decode(&cr); err != nil {
+		return nil, fmt.Errorf("cobalt: decode response: %w", err)
+	}
+
+	caption := fmt.Sprintf("[src](%s)", u.String())
+	switch cr.Status {
+	case "redirect", "stream":
+		if cr.URL == "" {
+			return nil, fmt.Errorf("cobalt: empty url for status %q", cr.Status)
+		}
+		return &Uploadable{VideoURL: cr.URL, Caption: caption}, nil
+	case "picker":
+		var images []string
+		for _, item := range cr.Picker {
+			if item.Type == "" || item.Type == "photo" {
+				images = append(images, item.URL)
+			}
+		}
+		if len(images) == 0 {
+			return nil, fmt.Errorf("cobalt: picker returned no images")
+		}
+		return &Uploadable{
+			Images:  &ImagesWithAudio{ImageURLs: images, AudioURL: cr.Audio},
+			Caption: caption,
+		}, nil
+	default:
+		return nil, fmt.Errorf("cobalt: unexpected status %q", cr.Status)
+	}
+}
+
+// instagramProvider is a stub: Instagram reels aren't resolved natively yet,
+// so callers fall through to cobaltProvider registered behind it.
+type instagramProvider struct{}
+
+func (instagramProvider) Respond(ctx context.Context, u *url.URL) (*Uploadable, error) {
+	return nil, fmt.Errorf("instagram: native provider not implemented yet")
+}
+
+// youtubeProvider is a stub for the same reason as instagramProvider, for
+// YouTube Shorts/reels links.
+type youtubeProvider struct{}
+
+func (youtubeProvider) Respond(ctx context.Context, u *url.URL) (*Uploadable, error) {
+	return nil, fmt.Errorf("youtube: native provider not implemented yet")
+}
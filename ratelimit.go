@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter is a simple per-user token bucket, used to cap how often a
+// single user can trigger a fetch against the upstream providers.
+type rateLimiter struct {
+	mu           sync.Mutex
+	buckets      map[int64]*tokenBucket
+	capacity     float64
+	refillPerSec float64
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(capacity int, per time.Duration) *rateLimiter {
+	return &rateLimiter{
+		buckets:      make(map[int64]*tokenBucket),
+		capacity:     float64(capacity),
+		refillPerSec: float64(capacity) / per.Seconds(),
+	}
+}
+
+// Allow reports whether userID has a token available and, if so, consumes
+// one.
+func (l *rateLimiter) Allow(userID int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[userID]
+	if !ok {
+		l.buckets[userID] = &tokenBucket{tokens: l.capacity - 1, last: now}
+		return true
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.refillPerSec
+	if b.tokens > l.capacity {
+		b.tokens = l.capacity
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// fetchLimiter caps how many provider fetches a single user can trigger per
+// minute, so one user can't burn through the tikwm quota for everybody else.
+var fetchLimiter = newRateLimiter(5, time.Minute)
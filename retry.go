@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+const (
+	retryMaxAttempts = 4
+	retryBaseDelay   = 500 * time.Millisecond
+	retryMaxDelay    = 8 * time.Second
+)
+
+// retryClass tells withRetry whether a failed attempt is worth retrying.
+type retryClass int
+
+const (
+	retryable retryClass = iota
+	terminal
+)
+
+// withRetry calls attempt up to retryMaxAttempts times with exponential
+// backoff and jitter between tries, honoring ctx cancellation. attempt
+// reports its own error's retryClass; withRetry stops early on a terminal
+// classification or once ctx is done. attemptNum passed to attempt is
+// 1-based.
+func withRetry(ctx context.Context, attempt func(attemptNum int) (retryClass, error)) error {
+	var lastErr error
+	for n := 1; n <= retryMaxAttempts; n++ {
+		class, err := attempt(n)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if class == terminal || n == retryMaxAttempts {
+			return lastErr
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoffDelay(n)):
+		}
+	}
+	return lastErr
+}
+
+// backoffDelay returns an exponentially growing delay for attemptNum (1-based),
+// capped at retryMaxDelay and jittered by up to half its value so retries
+// from multiple users don't line up.
+func backoffDelay(attemptNum int) time.Duration {
+	d := retryBaseDelay << (attemptNum - 1)
+	if d > retryMaxDelay || d <= 0 {
+		d = retryMaxDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)/2+1))
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const linksSchema = `
+CREATE TABLE IF NOT EXISTS links (
+	token       TEXT PRIMARY KEY,
+	url         TEXT NOT NULL,
+	created_at  INTEGER NOT NULL,
+	expires_at  INTEGER NOT NULL,
+	user_id     INTEGER NOT NULL,
+	chat_id     INTEGER NOT NULL,
+	result_kind TEXT NOT NULL DEFAULT '',
+	bytes_sent  INTEGER NOT NULL DEFAULT 0
+);
+`
+
+const allowlistSchema = `
+CREATE TABLE IF NOT EXISTS allowed_users (
+	user_id INTEGER PRIMARY KEY
+);
+`
+
+// Store is the SQLite-backed replacement for the old in-memory linkCache: it
+// survives restarts and doubles as the download history used by -dbinfo and
+// /stats.
+type Store struct {
+	db *sql.DB
+}
+
+func openStore(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(linksSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := db.Exec(allowlistSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// openStoreReadOnly opens path without creating it, for -dbinfo.
+func openStoreReadOnly(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=ro", path))
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Set stores link under a fresh token, recording the requesting user/chat,
+// and returns the token. ttl governs when get will start reporting it as
+// expired.
+func (s *Store) Set(link string, userID, chatID int64, ttl time.Duration) (string, error) {
+	token := randomToken(12)
+	now := time.Now()
+	_, err := s.db.Exec(
+		`INSERT INTO links (token, url, created_at, expires_at, user_id, chat_id) VALUES (?, ?, ?, ?, ?, ?)`,
+		token, link, now.Unix(), now.Add(ttl).Unix(), userID, chatID,
+	)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Get resolves token to its URL, expiring (and deleting) it lazily if its TTL
+// has passed.
+func (s *Store) Get(token string) (string, bool) {
+	var link string
+	var expiresAt int64
+	err := s.db.QueryRow(`SELECT url, expires_at FROM links WHERE token = ?`, token).Scan(&link, &expiresAt)
+	if err != nil {
+		return "", false
+	}
+	if time.Now().After(time.Unix(expiresAt, 0)) {
+		s.db.Exec(`DELETE FROM links WHERE token = ?`, token)
+		return "", false
+	}
+	return link, true
+}
+
+// RecordDelivery notes what a cached link resolved to once it's actually
+// been delivered to the user, for the byte/kind totals -dbinfo and /stats
+// report.
+func (s *Store) RecordDelivery(token, kind string, bytesSent int64) error {
+	_, err := s.db.Exec(
+		`UPDATE links SET result_kind = ?, bytes_sent = ? WHERE token = ?`,
+		kind, bytesSent, token,
+	)
+	return err
+}
+
+// Stats is the aggregate view shared by -dbinfo and /stats.
+type Stats struct {
+	TotalLinks  int
+	TotalBytes  int64
+	TopDomains  []DomainCount
+	RecentLinks []RecentLink
+}
+
+type DomainCount struct {
+	Domain string
+	Count  int
+}
+
+type RecentLink struct {
+	Token     string
+	URL       string
+	CreatedAt time.Time
+}
+
+func (s *Store) Stats(recentLimit int) (*Stats, error) {
+	stats := &Stats{}
+
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM links`).Scan(&stats.TotalLinks); err != nil {
+		return nil, err
+	}
+	if err := s.db.QueryRow(`SELECT COALESCE(SUM(bytes_sent), 0) FROM links`).Scan(&stats.TotalBytes); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT url FROM links`)
+	if err != nil {
+		return nil, err
+	}
+	domainCounts := make(map[string]int)
+	for rows.Next() {
+		var link string
+		if err := rows.Scan(&link); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if u, err := url.Parse(link); err == nil {
+			domainCounts[u.Hostname()]++
+		}
+	}
+	rows.Close()
+	for domain, count := range domainCounts {
+		stats.TopDomains = append(stats.TopDomains, DomainCount{Domain: domain, Count: count})
+	}
+	sort.Slice(stats.TopDomains, func(i, j int) bool {
+		return stats.TopDomains[i].Count > stats.TopDomains[j].Count
+	})
+
+	recentRows, err := s.db.Query(`SELECT token, url, created_at FROM links ORDER BY created_at DESC LIMIT ?`, recentLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer recentRows.Close()
+	for recentRows.Next() {
+		var rl RecentLink
+		var createdAt int64
+		if err := recentRows.Scan(&rl.Token, &rl.URL, &createdAt); err != nil {
+			return nil, err
+		}
+		rl.CreatedAt = time.Unix(createdAt, 0)
+		stats.RecentLinks = append(stats.RecentLinks, rl)
+	}
+	return stats, nil
+}
+
+// runDBInfo opens path read-only and prints the same aggregate Stats/stats
+// exposes, for operators inspecting the bot's database from the command
+// line via -dbinfo.
+func runDBInfo(path string) error {
+	store, err := openStoreReadOnly(path)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+	defer store.Close()
+
+	stats, err := store.Stats(10)
+	if err != nil {
+		return fmt.Errorf("query stats: %w", err)
+	}
+
+	fmt.Printf("db: %s\n", path)
+	fmt.Printf("total links: %d\n", stats.TotalLinks)
+	fmt.Printf("total bytes served: %d\n", stats.TotalBytes)
+
+	fmt.Println("top domains:")
+	for _, dc := range stats.TopDomains {
+		fmt.Printf("  %-30s %d\n", dc.Domain, dc.Count)
+	}
+
+	fmt.Println("recent tokens:")
+	for _, rl := range stats.RecentLinks {
+		fmt.Printf("  %-16s %s  %s\n", rl.Token, rl.CreatedAt.Format(time.RFC3339), rl.URL)
+	}
+	return nil
+}
+
+// Grant persists userID to the allowlist.
+func (s *Store) Grant(userID int64) error {
+	_, err := s.db.Exec(`INSERT OR IGNORE INTO allowed_users (user_id) VALUES (?)`, userID)
+	return err
+}
+
+// Revoke removes userID from the allowlist.
+func (s *Store) Revoke(userID int64) error {
+	_, err := s.db.Exec(`DELETE FROM allowed_users WHERE user_id = ?`, userID)
+	return err
+}
+
+// LoadAllowed returns every persisted allowlist entry, for merging into the
+// in-memory set at startup.
+func (s *Store) LoadAllowed() (map[int64]bool, error) {
+	rows, err := s.db.Query(`SELECT user_id FROM allowed_users`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out[id] = true
+	}
+	return out, rows.Err()
+}
+
+func formatStats(stats *Stats) string {
+	out := fmt.Sprintf("Всего ссылок: %d\nОтправлено байт: %d\n\nТоп доменов:\n", stats.TotalLinks, stats.TotalBytes)
+	for _, dc := range stats.TopDomains {
+		out += fmt.Sprintf("  %s: %d\n", dc.Domain, dc.Count)
+	}
+	return out
+}
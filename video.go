@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync/atomic"
+)
+
+const defaultMaxSlideshowBytes = 200 * 1024 * 1024
+
+// maxSlideshowBytes gates makeVideo behind a total download-size ceiling so a
+// huge (or malicious) slideshow can't OOM the bot. Override via
+// MAKEVIDEO_MAX_BYTES.
+func maxSlideshowBytes() int64 {
+	if v := os.Getenv("MAKEVIDEO_MAX_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultMaxSlideshowBytes
+}
+
+// makeVideo muxes imageURLs and audioURL into an MP4 slideshow via ffmpeg,
+// streaming each download straight into ffmpeg's input pipes rather than
+// buffering them in memory first. The returned ReadCloser is ffmpeg's stdout;
+// callers must Close it once they're done reading to reap the process.
+func makeVideo(ctx context.Context, imageURLs []string, audioURL string, duration int) (io.ReadCloser, error) {
+	if duration <= 0 {
+		duration = 10
+	}
+
+	limit := maxSlideshowBytes()
+
+	total, sizeErr := totalContentLength(append(append([]string{}, imageURLs...), audioURL))
+	if sizeErr != nil {
+		logTikTok("makeVideo content_length_check status=error err=%v", sizeErr)
+	}
+	if total > limit {
+		return nil, fmt.Errorf("makeVideo: slideshow is ~%d bytes, exceeds %d byte ceiling", total, limit)
+	}
+
+	// The Content-Length check above is only a best-effort pre-flight
+	// estimate: a server that omits or lies about it would otherwise bypass
+	// the ceiling entirely. ceiling enforces the real limit against bytes
+	// actually streamed, shared across both downloads below.
+	ceiling := &byteCeiling{limit: limit}
+
+	imgReader, imgWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	audReader, audWriter, err := os.Pipe()
+	if err != nil {
+		imgReader.Close()
+		imgWriter.Close()
+		return nil, err
+	}
+
+	frameRate := float64(len(imageURLs)) / float64(duration)
+	vf := "scale=480:854:force_original_aspect_ratio=decrease,pad=480:854:(ow-iw)/2:(oh-ih)/2,setsar=1"
+
+	cmd := exec.CommandContext(ctx, "ffmpeg", "-y",
+		"-framerate", fmt.Sprintf("%f", frameRate),
+		"-f", "image2pipe", "-i", "pipe:3",
+		"-i", "pipe:4",
+		"-c:v", "libx264", "-preset", "ultrafast", "-tune", "stillimage",
+		"-c:a", "aac", "-b:a", "96k",
+		"-pix_fmt", "yuv420p", "-vf", vf,
+		"-shortest", "-fflags", "+genpts",
+		"-movflags", "frag_keyframe+empty_moov+default_base_moof",
+		"-f", "mp4", "pipe:1",
+	)
+	cmd.ExtraFiles = []*os.File{imgReader, audReader}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		imgReader.Close()
+		imgWriter.Close()
+		audReader.Close()
+		audWriter.Close()
+		return nil, err
+	}
+	stderr := &limitedBuffer{limit: 4096}
+	cmd.Stderr = stderr
+
+	if err := cmd.Start(); err != nil {
+		imgReader.Close()
+		imgWriter.Close()
+		audReader.Close()
+		audWriter.Close()
+		return nil, err
+	}
+
+	go func() {
+		defer imgWriter.Close()
+		for i, u := range imageURLs {
+			if err := streamDownload(ctx, u, imgWriter, fmt.Sprintf("image[%d]", i), ceiling); err != nil {
+				logTikTok("makeVideo image_download status=error idx=%d url=%s err=%v", i, u, err)
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer audWriter.Close()
+		if err := streamDownload(ctx, audioURL, audWriter, "audio", ceiling); err != nil {
+			logTikTok("makeVideo audio_download status=error url=%s err=%v", audioURL, err)
+		}
+	}()
+
+	return &ffmpegOutput{ReadCloser: stdout, cmd: cmd, stderr: stderr}, nil
+}
+
+// ffmpegOutput wraps ffmpeg's stdout pipe so Close both releases the pipe and
+// waits on the process, surfacing stderr on a non-zero exit.
+type ffmpegOutput struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *limitedBuffer
+}
+
+func (o *ffmpegOutput) Close() error {
+	closeErr := o.ReadCloser.Close()
+	if err := o.cmd.Wait(); err != nil {
+		return fmt.Errorf("ffmpeg: %v, stderr: %s", err, o.stderr.String())
+	}
+	return closeErr
+}
+
+// streamDownload copies url's body directly into dst, logging progress
+// against the response's Content-Length via progressReader, and aborting if
+// ceiling's total is exceeded partway through.
+func streamDownload(ctx context.Context, url string, dst io.Writer, label string, ceiling *byteCeiling) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(&ceilingWriter{dst: dst, ceiling: ceiling}, newProgressReader(resp.Body, label, resp.ContentLength))
+	return err
+}
+
+// byteCeiling is a running, concurrency-safe total shared across every
+// streamDownload call in a single makeVideo, so the combined bytes actually
+// copied -- not just what Content-Length claims -- can't exceed limit.
+type byteCeiling struct {
+	limit int64
+	used  int64
+}
+
+func (c *byteCeiling) add(n int64) error {
+	if atomic.AddInt64(&c.used, n) > c.limit {
+		return fmt.Errorf("byteCeiling: exceeded %d byte ceiling", c.limit)
+	}
+	return nil
+}
+
+// ceilingWriter enforces ceiling against every chunk written to dst, so a
+// server that omits or understates Content-Length still can't stream past
+// the limit.
+type ceilingWriter struct {
+	dst     io.Writer
+	ceiling *byteCeiling
+}
+
+func (w *ceilingWriter) Write(p []byte) (int, error) {
+	if err := w.ceiling.add(int64(len(p))); err != nil {
+		return 0, err
+	}
+	return w.dst.Write(p)
+}
+
+// totalContentLength sums the Content-Length reported for each url via HEAD,
+// for the pre-flight size check in makeVideo. URLs whose length can't be
+// determined contribute 0, so the check is best-effort, not exact.
+func totalContentLength(urls []string) (int64, error) {
+	var total int64
+	var firstErr error
+	for _, u := range urls {
+		size, err := fetchContentLength(u)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		total += size
+	}
+	return total, firstErr
+}
+
+// progressReader logs download progress in 10% increments against total
+// (the HTTP Content-Length), for visibility into long slideshow downloads.
+type progressReader struct {
+	io.Reader
+	label      string
+	total      int64
+	read       int64
+	lastLogPct int
+}
+
+func newProgressReader(r io.Reader, label string, total int64) *progressReader {
+	return &progressReader{Reader: r, label: label, total: total, lastLogPct: -1}
+}
+
+func (p *progressReader) Read(buf []byte) (int, error) {
+	n, err := p.Reader.Read(buf)
+	p.read += int64(n)
+	if p.total > 0 {
+		pct := int(p.read * 100 / p.total)
+		if pct != p.lastLogPct && pct%10 == 0 {
+			logTikTok("makeVideo progress label=%s bytes=%d/%d pct=%d", p.label, p.read, p.total, pct)
+			p.lastLogPct = pct
+		}
+	}
+	return n, err
+}
+
+// countingReader tallies bytes read, for recording bytes_sent after a
+// streamed upload completes.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(buf []byte) (int, error) {
+	n, err := c.Reader.Read(buf)
+	c.n += int64(n)
+	return n, err
+}
+
+// limitedBuffer caps how much ffmpeg stderr it retains, so a chatty failure
+// can't balloon memory the way the old full-buffer approach could.
+type limitedBuffer struct {
+	buf   []byte
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - len(b.buf); room > 0 {
+		if len(p) > room {
+			b.buf = append(b.buf, p[:room]...)
+		} else {
+			b.buf = append(b.buf, p...)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	return string(b.buf)
+}